@@ -0,0 +1,129 @@
+// Package v1 defines the Wordpress custom resource, registered with the
+// EKS cluster so that add-on state lives in the API server instead of in
+// the aws-k8s-tester process.
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName is the API group the Wordpress custom resource is registered under.
+const GroupName = "aws-k8s-tester.k8s.io"
+
+// SchemeGroupVersion is group version used to register these objects.
+var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1"}
+
+// SchemeBuilder collects functions that add things to a scheme, and AddToScheme
+// applies all the stored functions to the scheme, registering Wordpress with it.
+var (
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	AddToScheme   = SchemeBuilder.AddToScheme
+)
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&Wordpress{},
+		&WordpressList{},
+	)
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
+
+// WordpressSpec describes the desired state of a Wordpress installation.
+type WordpressSpec struct {
+	// Replicas is the number of Wordpress pod replicas.
+	Replicas int32 `json:"replicas"`
+	// Image is the Wordpress container image, e.g. "bitnami/wordpress:5.8.1".
+	Image string `json:"image"`
+	// DatabaseSize is the PVC size requested for both the MariaDB StatefulSet
+	// and the Wordpress data volume (e.g. "8Gi").
+	DatabaseSize string `json:"databaseSize"`
+	// StorageClass is the StorageClassName used for the Wordpress and MariaDB PVCs.
+	StorageClass string `json:"storageClass"`
+	// AccessModes are the PVC access modes for the Wordpress data volume, e.g.
+	// ["ReadWriteOnce"] for EBS or ["ReadWriteMany"] for EFS. Defaults to
+	// ["ReadWriteOnce"] when empty.
+	AccessModes []string `json:"accessModes,omitempty"`
+	// ServiceType is the Kubernetes Service type fronting Wordpress (e.g. "LoadBalancer").
+	ServiceType string `json:"serviceType"`
+	// DatabaseUser is the MySQL user Wordpress connects to MariaDB as.
+	DatabaseUser string `json:"databaseUser"`
+	// DatabasePassword is DatabaseUser's password. It also becomes
+	// MariaDB's MARIADB_ROOT_PASSWORD, matching the old Helm values.
+	DatabasePassword string `json:"databasePassword"`
+}
+
+// WordpressStatus describes the observed state of a Wordpress installation.
+type WordpressStatus struct {
+	// URL is the externally reachable URL once the Service has a LoadBalancer ingress.
+	URL string `json:"url,omitempty"`
+	// Ready is true once the Wordpress Deployment has at least Replicas ready
+	// pods (and Replicas > 0). The PVC, Service, and MariaDB StatefulSet are
+	// not checked.
+	Ready bool `json:"ready"`
+	// ObservedGeneration is the most recent generation the controller has reconciled.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Wordpress is the Schema for the Wordpress custom resource.
+type Wordpress struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WordpressSpec   `json:"spec,omitempty"`
+	Status WordpressStatus `json:"status,omitempty"`
+}
+
+// DeepCopyObject implements runtime.Object.
+func (w *Wordpress) DeepCopyObject() runtime.Object {
+	if w == nil {
+		return nil
+	}
+	out := new(Wordpress)
+	w.DeepCopyInto(out)
+	return out
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// WordpressList is a list of Wordpress objects.
+type WordpressList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Wordpress `json:"items"`
+}
+
+// DeepCopyObject implements runtime.Object.
+func (wl *WordpressList) DeepCopyObject() runtime.Object {
+	if wl == nil {
+		return nil
+	}
+	out := new(WordpressList)
+	out.TypeMeta = wl.TypeMeta
+	wl.ListMeta.DeepCopyInto(&out.ListMeta)
+	if wl.Items != nil {
+		out.Items = make([]Wordpress, len(wl.Items))
+		for i := range wl.Items {
+			wl.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
+
+// DeepCopyInto copies the receiver into out.
+func (w *Wordpress) DeepCopyInto(out *Wordpress) {
+	*out = *w
+	out.TypeMeta = w.TypeMeta
+	w.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = w.Spec
+	if w.Spec.AccessModes != nil {
+		out.Spec.AccessModes = make([]string, len(w.Spec.AccessModes))
+		copy(out.Spec.AccessModes, w.Spec.AccessModes)
+	}
+	out.Status = w.Status
+}
@@ -8,17 +8,24 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aws/aws-k8s-tester/eks/wordpress"
+	"github.com/aws/aws-k8s-tester/eksconfig"
 	awscfn "github.com/aws/aws-k8s-tester/pkg/aws/cloudformation"
+	"github.com/aws/aws-k8s-tester/pkg/aws/iam/policyfragments"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"go.uber.org/zap"
 )
 
-// TemplateClusterRoleBasic is the CloudFormation template for EKS cluster role.
-const TemplateClusterRoleBasic = `
+// templateClusterRole is the CloudFormation template for the EKS cluster
+// role. Its Policies list is generated at creation time from the
+// policyfragments registered by each enabled add-on (see
+// enabledPolicyFragmentNames), rather than picking between a handful of
+// hardcoded templates.
+const templateClusterRole = `
 ---
 AWSTemplateFormatVersion: '2010-09-09'
-Description: 'Amazon EKS Cluster Role Basic'
+Description: 'Amazon EKS Cluster Role'
 
 Parameters:
 
@@ -52,6 +59,7 @@ Resources:
           - sts:AssumeRole
       ManagedPolicyArns: !Ref ClusterRoleManagedPolicyARNs
       Path: /
+      Policies: %s
 
 Outputs:
 
@@ -61,67 +69,23 @@ Outputs:
 
 `
 
-// TemplateClusterRoleNLB is the CloudFormation template for EKS cluster role
-// with policies required for NLB service operation.
-//
-// e.g.
-//   Error creating load balancer (will retry): failed to ensure load balancer for service eks-*/hello-world-service: Error creating load balancer: "AccessDenied: User: arn:aws:sts::404174646922:assumed-role/eks-*-cluster-role/* is not authorized to perform: ec2:DescribeAccountAttributes\n\tstatus code: 403"
-//
-// TODO: scope down (e.g. ec2:DescribeAccountAttributes, ec2:DescribeInternetGateways)
-const TemplateClusterRoleNLB = `
----
-AWSTemplateFormatVersion: '2010-09-09'
-Description: 'Amazon EKS Cluster Role + NLB'
-
-Parameters:
-
-  ClusterRoleName:
-    Description: EKS Role name
-    Type: String
-
-  ClusterRoleServicePrincipals:
-    Description: EKS Role Service Principals
-    Type: CommaDelimitedList
-    Default: eks.amazonaws.com
-
-  ClusterRoleManagedPolicyARNs:
-    Description: EKS Role managed policy ARNs
-    Type: CommaDelimitedList
-    Default: 'arn:aws:iam::aws:policy/AmazonEKSServicePolicy,arn:aws:iam::aws:policy/AmazonEKSClusterPolicy'
-
-Resources:
-
-  ClusterRole:
-    Type: AWS::IAM::Role
-    Properties:
-      RoleName: !Ref ClusterRoleName
-      AssumeRolePolicyDocument:
-        Version: '2012-10-17'
-        Statement:
-        - Effect: Allow
-          Principal:
-            Service: !Ref ClusterRoleServicePrincipals
-          Action:
-          - sts:AssumeRole
-      ManagedPolicyArns: !Ref ClusterRoleManagedPolicyARNs
-      Path: /
-      Policies:
-      - PolicyName: !Join ['-', [!Ref ClusterRoleName, 'nlb-policy']]
-        PolicyDocument:
-          Version: '2012-10-17'
-          Statement:
-          - Action:
-            - ec2:*
-            Effect: Allow
-            Resource: '*'
-
-Outputs:
-
-  ClusterRoleARN:
-    Description: Cluster role ARN that EKS uses to create AWS resources for Kubernetes
-    Value: !GetAtt ClusterRole.Arn
-
-`
+// enabledPolicyFragmentNames returns the policyfragments.Get names for
+// every add-on enabled in cfg that needs cluster-role permissions.
+func enabledPolicyFragmentNames(cfg *eksconfig.Config) (names []string) {
+	if cfg.AddOnNLBHelloWorld.Enable {
+		names = append(names, policyfragments.NLB)
+	}
+	if cfg.AddOnWordpress.Enable {
+		// Wordpress fronts itself with its own NLB, so it needs policyfragments.NLB
+		// whether or not AddOnNLBHelloWorld is also enabled; policyfragments.Get
+		// dedupes by name, so the two adds above don't render a duplicate policy.
+		names = append(names, policyfragments.Wordpress, policyfragments.NLB)
+		if cfg.AddOnWordpress.PersistenceMode == wordpress.PersistenceModeEFS {
+			names = append(names, policyfragments.EFSCSI)
+		}
+	}
+	return names
+}
 
 func (ts *Tester) createClusterRole() error {
 	if !ts.cfg.Parameters.ClusterRoleCreate {
@@ -138,10 +102,12 @@ func (ts *Tester) createClusterRole() error {
 		return errors.New("empty Parameters.ClusterRoleName")
 	}
 
-	tmpl := TemplateClusterRoleBasic
-	if ts.cfg.AddOnNLBHelloWorld.Enable {
-		tmpl = TemplateClusterRoleNLB
+	fragments := policyfragments.Get(enabledPolicyFragmentNames(ts.cfg)...)
+	policiesJSON, err := policyfragments.RenderCFNPolicies(ts.cfg.Parameters.ClusterRoleName, ts.cfg.Name, fragments)
+	if err != nil {
+		return fmt.Errorf("failed to render cluster role policy fragments: %w", err)
 	}
+	tmpl := fmt.Sprintf(templateClusterRole, policiesJSON)
 
 	// role ARN is empty, create a default role
 	// otherwise, use the existing one
@@ -180,37 +146,31 @@ func (ts *Tester) createClusterRole() error {
 			ParameterValue: aws.String(strings.Join(ts.cfg.Parameters.ClusterRoleManagedPolicyARNs, ",")),
 		})
 	}
-	stackOutput, err := ts.cfnAPI.CreateStack(stackInput)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	stack, err := awscfn.CreateWithCleanup(ctx, ts.cfnAPI, stackInput, awscfn.CreateWithCleanupOpts{
+		StopCreationCh: ts.stopCreationCh,
+		InterruptSig:   ts.interruptSig,
+		Logger:         ts.lg,
+		DesiredStatus:  cloudformation.ResourceStatusCreateComplete,
+		PollInterval:   25 * time.Second,
+		InitialWait:    10 * time.Second,
+		MarkCleanupRequired: func(stackID string) {
+			ts.cfg.Status.ClusterRoleCFNStackID = stackID
+			ts.cfg.Status.ClusterRoleCFNStackIDCleanupRequired = true
+			ts.cfg.Sync()
+		},
+		ClearCleanupRequired: func() {
+			ts.cfg.Status.ClusterRoleCFNStackIDCleanupRequired = false
+			ts.cfg.Sync()
+		},
+	})
 	if err != nil {
+		ts.cfg.RecordStatus(fmt.Sprintf("failed to create role (%v)", err))
 		return err
 	}
-	ts.cfg.Status.ClusterRoleCFNStackID = aws.StringValue(stackOutput.StackId)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	ch := awscfn.Poll(
-		ctx,
-		ts.stopCreationCh,
-		ts.interruptSig,
-		ts.lg,
-		ts.cfnAPI,
-		ts.cfg.Status.ClusterRoleCFNStackID,
-		cloudformation.ResourceStatusCreateComplete,
-		25*time.Second,
-		10*time.Second,
-	)
-	var st awscfn.StackStatus
-	for st = range ch {
-		if st.Error != nil {
-			cancel()
-			ts.cfg.RecordStatus(fmt.Sprintf("failed to create role (%v)", st.Error))
-			ts.lg.Warn("polling errror", zap.Error(st.Error))
-		}
-	}
-	cancel()
-	if st.Error != nil {
-		return st.Error
-	}
 	// update status after creating a new IAM role
-	for _, o := range st.Stack.Outputs {
+	for _, o := range stack.Outputs {
 		switch k := aws.StringValue(o.OutputKey); k {
 		case "ClusterRoleARN":
 			ts.cfg.Status.ClusterRoleARN = aws.StringValue(o.OutputValue)
@@ -273,5 +233,6 @@ func (ts *Tester) deleteClusterRole() error {
 		zap.String("cluster-role-arn", ts.cfg.Status.ClusterRoleARN),
 		zap.String("cluster-role-name", ts.cfg.Parameters.ClusterRoleName),
 	)
+	ts.cfg.Status.ClusterRoleCFNStackIDCleanupRequired = false
 	return ts.cfg.Sync()
 }
@@ -0,0 +1,272 @@
+package wordpress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-k8s-tester/eks/helm"
+	awscfn "github.com/aws/aws-k8s-tester/pkg/aws/cloudformation"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"go.uber.org/zap"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	efsCSIChartRepoName = "aws-efs-csi-driver"
+	efsCSIChartRepoURL  = "https://kubernetes-sigs.github.io/aws-efs-csi-driver"
+	efsCSIChartName     = "aws-efs-csi-driver"
+	efsStorageClassName = "efs-sc"
+)
+
+// templateEFSFileSystem is the CloudFormation template for an EFS file
+// system plus one mount target per subnet in the cluster VPC, used to
+// back AddOnWordpress.PersistenceMode == "efs". The MountTarget resources
+// are generated at render time (see mountTargetsYAML) since EFS needs one
+// per AZ a node group runs in, and the subnet count is only known at
+// runtime.
+const templateEFSFileSystem = `
+---
+AWSTemplateFormatVersion: '2010-09-09'
+Description: 'EFS file system for the Wordpress add-on'
+
+Parameters:
+
+  VPCID:
+    Description: EKS cluster VPC ID
+    Type: AWS::EC2::VPC::Id
+
+  SubnetIDs:
+    Description: EKS cluster subnet IDs to create mount targets in
+    Type: List<AWS::EC2::Subnet::Id>
+
+  ClusterSecurityGroupID:
+    Description: EKS cluster shared security group ID, attached to worker nodes and allowed to reach NFS
+    Type: AWS::EC2::SecurityGroup::Id
+
+Resources:
+
+  MountTargetSecurityGroup:
+    Type: AWS::EC2::SecurityGroup
+    Properties:
+      GroupDescription: Allow NFS from the EKS cluster
+      VpcId: !Ref VPCID
+      SecurityGroupIngress:
+      - IpProtocol: tcp
+        FromPort: 2049
+        ToPort: 2049
+        SourceSecurityGroupId: !Ref ClusterSecurityGroupID
+
+  FileSystem:
+    Type: AWS::EFS::FileSystem
+    Properties:
+      Encrypted: true
+      FileSystemTags:
+      - Key: Name
+        Value: !Ref AWS::StackName
+%s
+Outputs:
+
+  FileSystemID:
+    Description: EFS file system ID
+    Value: !Ref FileSystem
+
+`
+
+// mountTargetsYAML returns one AWS::EFS::MountTarget resource per subnet
+// in subnetIDs, each pinned to its own index into the SubnetIDs parameter,
+// so pods scheduled in any AZ of a multi-AZ node group can mount the file
+// system (EFS requires a mount target per AZ a client runs in).
+func mountTargetsYAML(subnetIDs []string) string {
+	var b strings.Builder
+	for i := range subnetIDs {
+		fmt.Fprintf(&b, `
+  MountTarget%d:
+    Type: AWS::EFS::MountTarget
+    Properties:
+      FileSystemId: !Ref FileSystem
+      SubnetId: !Select [%d, !Ref SubnetIDs]
+      SecurityGroups:
+      - !Ref MountTargetSecurityGroup
+`, i, i)
+	}
+	return b.String()
+}
+
+func (ts *tester) createEFSFileSystem() error {
+	if ts.cfg.EKSConfig.AddOnWordpress.EFSFileSystemID != "" {
+		ts.cfg.Logger.Info("non-empty EFS file system ID given; no need to create a new one")
+		return ts.installEFSCSIDriver()
+	}
+
+	stackName := ts.cfg.EKSConfig.Name + "-wordpress-efs"
+	subnetIDsCSV := ts.cfg.EKSConfig.Parameters.SubnetIDsCSV()
+	if subnetIDsCSV == "" {
+		return errors.New("empty Parameters.SubnetIDsCSV; cannot create EFS mount targets without subnets")
+	}
+	subnetIDs := strings.Split(subnetIDsCSV, ",")
+	tmpl := fmt.Sprintf(templateEFSFileSystem, mountTargetsYAML(subnetIDs))
+
+	ts.cfg.Logger.Info("creating EFS file system for Wordpress", zap.String("stack-name", stackName), zap.Int("mount-targets", len(subnetIDs)))
+	stackInput := &cloudformation.CreateStackInput{
+		StackName:    aws.String(stackName),
+		OnFailure:    aws.String(cloudformation.OnFailureDelete),
+		TemplateBody: aws.String(tmpl),
+		Tags: awscfn.NewTags(map[string]string{
+			"Kind": "aws-k8s-tester",
+			"Name": ts.cfg.EKSConfig.Name,
+		}),
+		Parameters: []*cloudformation.Parameter{
+			{ParameterKey: aws.String("VPCID"), ParameterValue: aws.String(ts.cfg.EKSConfig.Status.VPCID)},
+			{ParameterKey: aws.String("SubnetIDs"), ParameterValue: aws.String(ts.cfg.EKSConfig.Parameters.SubnetIDsCSV())},
+			{ParameterKey: aws.String("ClusterSecurityGroupID"), ParameterValue: aws.String(ts.cfg.EKSConfig.Status.ClusterSecurityGroupID)},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	stack, err := awscfn.CreateWithCleanup(ctx, ts.cfg.CFNAPI, stackInput, awscfn.CreateWithCleanupOpts{
+		StopCreationCh: ts.cfg.Stopc,
+		InterruptSig:   ts.cfg.Sig,
+		Logger:         ts.cfg.Logger,
+		DesiredStatus:  cloudformation.ResourceStatusCreateComplete,
+		PollInterval:   25 * time.Second,
+		InitialWait:    10 * time.Second,
+		MarkCleanupRequired: func(stackID string) {
+			ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackID = stackID
+			ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackIDCleanupRequired = true
+			ts.cfg.EKSConfig.Sync()
+		},
+		ClearCleanupRequired: func() {
+			ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackIDCleanupRequired = false
+			ts.cfg.EKSConfig.Sync()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, o := range stack.Outputs {
+		switch k := aws.StringValue(o.OutputKey); k {
+		case "FileSystemID":
+			ts.cfg.EKSConfig.AddOnWordpress.EFSFileSystemID = aws.StringValue(o.OutputValue)
+		default:
+			return fmt.Errorf("unexpected OutputKey %q from %q", k, ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackID)
+		}
+	}
+
+	ts.cfg.Logger.Info("created EFS file system for Wordpress",
+		zap.String("efs-cfn-stack-id", ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackID),
+		zap.String("efs-file-system-id", ts.cfg.EKSConfig.AddOnWordpress.EFSFileSystemID),
+	)
+	if err := ts.cfg.EKSConfig.Sync(); err != nil {
+		return err
+	}
+	return ts.installEFSCSIDriver()
+}
+
+func (ts *tester) deleteEFSFileSystem() error {
+	if ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackID == "" {
+		ts.cfg.Logger.Info("empty EFS CFN stack ID; no need to delete EFS file system")
+		return nil
+	}
+
+	ts.cfg.Logger.Info("deleting EFS CFN stack", zap.String("efs-cfn-stack-id", ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackID))
+	_, err := ts.cfg.CFNAPI.DeleteStack(&cloudformation.DeleteStackInput{
+		StackName: aws.String(ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackID),
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	ch := awscfn.Poll(
+		ctx,
+		make(chan struct{}),
+		ts.cfg.Sig,
+		ts.cfg.Logger,
+		ts.cfg.CFNAPI,
+		ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackID,
+		cloudformation.ResourceStatusDeleteComplete,
+		25*time.Second,
+		10*time.Second,
+	)
+	var st awscfn.StackStatus
+	for st = range ch {
+		if st.Error != nil {
+			cancel()
+			ts.cfg.Logger.Warn("polling errror", zap.Error(st.Error))
+		}
+	}
+	cancel()
+	if st.Error != nil {
+		return st.Error
+	}
+	ts.cfg.Logger.Info("deleted EFS file system for Wordpress", zap.String("efs-cfn-stack-id", ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackID))
+	ts.cfg.EKSConfig.AddOnWordpress.EFSCFNStackIDCleanupRequired = false
+	return ts.cfg.EKSConfig.Sync()
+}
+
+func (ts *tester) installEFSCSIDriver() error {
+	if err := helm.RepoAdd(ts.cfg.Logger, efsCSIChartRepoName, efsCSIChartRepoURL); err != nil {
+		return err
+	}
+	if err := helm.Install(helm.InstallConfig{
+		Logger:         ts.cfg.Logger,
+		Timeout:        10 * time.Minute,
+		KubeConfigPath: ts.cfg.EKSConfig.KubeConfigPath,
+		Namespace:      "kube-system",
+		ChartRepoURL:   efsCSIChartRepoURL,
+		ChartName:      efsCSIChartName,
+		ReleaseName:    efsCSIChartName,
+	}); err != nil {
+		return err
+	}
+	return ts.createEFSStorageClass()
+}
+
+func (ts *tester) createEFSStorageClass() error {
+	client := ts.cfg.K8SClient.KubernetesClientSet().StorageV1().StorageClasses()
+	sc := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: efsStorageClassName},
+		Provisioner: "efs.csi.aws.com",
+		Parameters: map[string]string{
+			"provisioningMode": "efs-ap",
+			"fileSystemId":     ts.cfg.EKSConfig.AddOnWordpress.EFSFileSystemID,
+			"directoryPerms":   "700",
+		},
+	}
+	_, err := client.Get(context.Background(), sc.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.Create(context.Background(), sc, metav1.CreateOptions{})
+	}
+	return err
+}
+
+// storageClassAndAccessModes translates AddOnWordpress.PersistenceMode into
+// the StorageClassName and PVC AccessModes the Wordpress CR is created
+// with. EBS volumes are ReadWriteOnce, so wordpress.replicaCount > 1 only
+// works with PersistenceModeEFS.
+func (ts *tester) storageClassAndAccessModes() (storageClass string, accessModes []string) {
+	switch ts.cfg.EKSConfig.AddOnWordpress.PersistenceMode {
+	case PersistenceModeEFS:
+		return efsStorageClassName, []string{"ReadWriteMany"}
+	case PersistenceModeEBSGP3:
+		return "gp3", []string{"ReadWriteOnce"}
+	case PersistenceModeEBSGP2, "":
+		return "gp2", []string{"ReadWriteOnce"}
+	default:
+		return ts.cfg.EKSConfig.AddOnWordpress.PersistenceMode, []string{"ReadWriteOnce"}
+	}
+}
+
+// setUpPersistence provisions whatever backing storage PersistenceMode
+// requires before the Wordpress CR is applied.
+func (ts *tester) setUpPersistence() error {
+	if ts.cfg.EKSConfig.AddOnWordpress.PersistenceMode != PersistenceModeEFS {
+		return nil
+	}
+	return ts.createEFSFileSystem()
+}
@@ -0,0 +1,98 @@
+package cloudformation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"go.uber.org/zap"
+)
+
+// CreateWithCleanupOpts configures CreateWithCleanup.
+type CreateWithCleanupOpts struct {
+	// StopCreationCh and InterruptSig are forwarded to Poll; nil means
+	// "never interrupt", matching Poll's own zero-value behavior.
+	StopCreationCh chan struct{}
+	InterruptSig   chan os.Signal
+
+	Logger        *zap.Logger
+	DesiredStatus string
+	PollInterval  time.Duration
+	InitialWait   time.Duration
+
+	// MarkCleanupRequired is called with the new stack's ID as soon as
+	// CreateStack returns one, so a marker can be recorded (e.g. onto
+	// EKSConfig.Status) before polling even starts. ClearCleanupRequired
+	// is called once the stack reaches DesiredStatus, or once its
+	// automatic rollback DeleteStack reaches DELETE_COMPLETE. Both may be
+	// nil.
+	MarkCleanupRequired  func(stackID string)
+	ClearCleanupRequired func()
+}
+
+// CreateWithCleanup calls CreateStack, polls until opts.DesiredStatus, and
+// on any polling error, interrupt, or context cancellation, automatically
+// issues DeleteStack and waits for DELETE_COMPLETE before returning the
+// original error. This is the "run destruction if creation starts"
+// finalizer pattern: aws-k8s-tester should never leave a half-created IAM
+// role, NLB security group, or VPC behind after a Ctrl-C.
+func CreateWithCleanup(ctx context.Context, cfnAPI cloudformationiface.CloudFormationAPI, input *cloudformation.CreateStackInput, opts CreateWithCleanupOpts) (*cloudformation.Stack, error) {
+	out, err := cfnAPI.CreateStack(input)
+	if err != nil {
+		return nil, err
+	}
+	stackID := aws.StringValue(out.StackId)
+	if opts.MarkCleanupRequired != nil {
+		opts.MarkCleanupRequired(stackID)
+	}
+
+	stopc := opts.StopCreationCh
+	if stopc == nil {
+		stopc = make(chan struct{})
+	}
+	sigc := opts.InterruptSig
+	if sigc == nil {
+		sigc = make(chan os.Signal)
+	}
+
+	ch := Poll(ctx, stopc, sigc, opts.Logger, cfnAPI, stackID, opts.DesiredStatus, opts.PollInterval, opts.InitialWait)
+	var st StackStatus
+	for st = range ch {
+	}
+	if st.Error == nil {
+		if opts.ClearCleanupRequired != nil {
+			opts.ClearCleanupRequired()
+		}
+		return st.Stack, nil
+	}
+
+	createErr := st.Error
+	if opts.Logger != nil {
+		opts.Logger.Warn("stack create did not complete; deleting to avoid an orphaned stack",
+			zap.String("stack-id", stackID),
+			zap.Error(createErr),
+		)
+	}
+	if _, delErr := cfnAPI.DeleteStack(&cloudformation.DeleteStackInput{StackName: aws.String(stackID)}); delErr != nil {
+		return nil, fmt.Errorf("create failed (%v) and cleanup delete also failed (%v)", createErr, delErr)
+	}
+
+	delCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	delCh := Poll(delCtx, make(chan struct{}), make(chan os.Signal), opts.Logger, cfnAPI, stackID, cloudformation.ResourceStatusDeleteComplete, opts.PollInterval, opts.InitialWait)
+	var delSt StackStatus
+	for delSt = range delCh {
+	}
+	if delSt.Error != nil {
+		return nil, fmt.Errorf("create failed (%v) and cleanup delete did not complete (%v)", createErr, delSt.Error)
+	}
+
+	if opts.ClearCleanupRequired != nil {
+		opts.ClearCleanupRequired()
+	}
+	return nil, createErr
+}
@@ -0,0 +1,133 @@
+package cloudformation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+)
+
+var errCreateStack = errors.New("create stack failed")
+
+// fakeCFNAPI stubs just the calls CreateWithCleanup/Poll make against a
+// single stack, driving DescribeStacks through a queue of statuses so the
+// test controls exactly how many polls it takes to settle.
+type fakeCFNAPI struct {
+	cloudformationiface.CloudFormationAPI
+
+	createErr error
+	deleteErr error
+	statuses  []string // consumed front-to-back by DescribeStacks; last value repeats
+	deleted   bool
+}
+
+func (f *fakeCFNAPI) CreateStack(in *cloudformation.CreateStackInput) (*cloudformation.CreateStackOutput, error) {
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	return &cloudformation.CreateStackOutput{StackId: aws.String("stack-id-1")}, nil
+}
+
+func (f *fakeCFNAPI) DeleteStack(in *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error) {
+	f.deleted = true
+	if f.deleteErr != nil {
+		return nil, f.deleteErr
+	}
+	return &cloudformation.DeleteStackOutput{}, nil
+}
+
+func (f *fakeCFNAPI) DescribeStacks(in *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	status := f.statuses[0]
+	if len(f.statuses) > 1 {
+		f.statuses = f.statuses[1:]
+	}
+	return &cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{
+			{
+				StackId:     in.StackName,
+				StackName:   in.StackName,
+				StackStatus: aws.String(status),
+			},
+		},
+	}, nil
+}
+
+func TestCreateWithCleanupSucceeds(t *testing.T) {
+	api := &fakeCFNAPI{statuses: []string{cloudformation.ResourceStatusCreateComplete}}
+
+	var marked, cleared bool
+	stack, err := CreateWithCleanup(context.Background(), api, &cloudformation.CreateStackInput{}, CreateWithCleanupOpts{
+		DesiredStatus: cloudformation.ResourceStatusCreateComplete,
+		PollInterval:  10 * time.Millisecond,
+		InitialWait:   0,
+		MarkCleanupRequired: func(stackID string) {
+			marked = true
+			if stackID != "stack-id-1" {
+				t.Errorf("got stackID %q, want stack-id-1", stackID)
+			}
+		},
+		ClearCleanupRequired: func() { cleared = true },
+	})
+	if err != nil {
+		t.Fatalf("CreateWithCleanup returned error: %v", err)
+	}
+	if stack == nil || aws.StringValue(stack.StackStatus) != cloudformation.ResourceStatusCreateComplete {
+		t.Fatalf("got stack %+v, want a CREATE_COMPLETE stack", stack)
+	}
+	if !marked {
+		t.Error("MarkCleanupRequired was not called")
+	}
+	if !cleared {
+		t.Error("ClearCleanupRequired was not called")
+	}
+	if api.deleted {
+		t.Error("DeleteStack was called on a successful create")
+	}
+}
+
+func TestCreateWithCleanupDeletesOnFailure(t *testing.T) {
+	api := &fakeCFNAPI{
+		statuses: []string{cloudformation.ResourceStatusRollbackComplete, cloudformation.ResourceStatusDeleteComplete},
+	}
+
+	var marked, cleared bool
+	_, err := CreateWithCleanup(context.Background(), api, &cloudformation.CreateStackInput{}, CreateWithCleanupOpts{
+		DesiredStatus: cloudformation.ResourceStatusCreateComplete,
+		PollInterval:  10 * time.Millisecond,
+		InitialWait:   0,
+		MarkCleanupRequired: func(stackID string) {
+			marked = true
+		},
+		ClearCleanupRequired: func() { cleared = true },
+	})
+	if err == nil {
+		t.Fatal("expected CreateWithCleanup to return the create error")
+	}
+	if !marked {
+		t.Error("MarkCleanupRequired was not called")
+	}
+	if !api.deleted {
+		t.Error("DeleteStack was not called after the create failed")
+	}
+	if !cleared {
+		t.Error("ClearCleanupRequired should be called once the rollback DeleteStack reaches DELETE_COMPLETE, since there's nothing left to clean up")
+	}
+}
+
+func TestCreateWithCleanupCreateStackError(t *testing.T) {
+	api := &fakeCFNAPI{createErr: errCreateStack}
+	_, err := CreateWithCleanup(context.Background(), api, &cloudformation.CreateStackInput{}, CreateWithCleanupOpts{
+		DesiredStatus: cloudformation.ResourceStatusCreateComplete,
+		PollInterval:  10 * time.Millisecond,
+	})
+	if err != errCreateStack {
+		t.Fatalf("got err %v, want %v", err, errCreateStack)
+	}
+	if api.deleted {
+		t.Error("DeleteStack should not be called when CreateStack itself failed")
+	}
+}
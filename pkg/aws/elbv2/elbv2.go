@@ -0,0 +1,108 @@
+// Package elbv2 wraps the ELBv2 API calls needed to resolve a Service's
+// LoadBalancer Ingress hostname back to a real NLB/ALB, its target groups,
+// and per-target health.
+package elbv2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// LoadBalancer describes a load balancer resolved from a DNS name, as
+// opposed to guessed from the hostname string.
+type LoadBalancer struct {
+	Name            string
+	ARN             string
+	DNSName         string
+	Type            string
+	TargetGroupARNs []string
+}
+
+// TargetHealth describes the health of a single target registered in a
+// target group, as returned by DescribeTargetHealth.
+type TargetHealth struct {
+	TargetGroupARN string
+	TargetID       string
+	Port           int64
+	State          string
+	Reason         string
+	Description    string
+}
+
+// FindByDNSName calls DescribeLoadBalancers and returns the LoadBalancer
+// whose DNSName matches dnsName, along with its target group ARNs. This
+// replaces deriving the name/ARN from the hostname string, which breaks
+// on any NLB whose name itself contains dashes.
+func FindByDNSName(api elbv2iface.ELBV2API, dnsName string) (LoadBalancer, error) {
+	dnsName = strings.TrimSuffix(strings.ToLower(dnsName), ".")
+
+	var found *elbv2.LoadBalancer
+	err := api.DescribeLoadBalancersPages(
+		&elbv2.DescribeLoadBalancersInput{},
+		func(out *elbv2.DescribeLoadBalancersOutput, lastPage bool) bool {
+			for _, lb := range out.LoadBalancers {
+				if strings.TrimSuffix(strings.ToLower(aws.StringValue(lb.DNSName)), ".") == dnsName {
+					found = lb
+					return false
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return LoadBalancer{}, err
+	}
+	if found == nil {
+		return LoadBalancer{}, fmt.Errorf("no load balancer found for DNS name %q", dnsName)
+	}
+
+	tgOut, err := api.DescribeTargetGroups(&elbv2.DescribeTargetGroupsInput{
+		LoadBalancerArn: found.LoadBalancerArn,
+	})
+	if err != nil {
+		return LoadBalancer{}, fmt.Errorf("failed to describe target groups for %q: %w", aws.StringValue(found.LoadBalancerArn), err)
+	}
+	tgARNs := make([]string, 0, len(tgOut.TargetGroups))
+	for _, tg := range tgOut.TargetGroups {
+		tgARNs = append(tgARNs, aws.StringValue(tg.TargetGroupArn))
+	}
+
+	return LoadBalancer{
+		Name:            aws.StringValue(found.LoadBalancerName),
+		ARN:             aws.StringValue(found.LoadBalancerArn),
+		DNSName:         aws.StringValue(found.DNSName),
+		Type:            aws.StringValue(found.Type),
+		TargetGroupARNs: tgARNs,
+	}, nil
+}
+
+// DescribeTargetHealth calls DescribeTargetHealth for a single target
+// group and returns the health of every registered target.
+func DescribeTargetHealth(api elbv2iface.ELBV2API, targetGroupARN string) ([]TargetHealth, error) {
+	out, err := api.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe target health for %q: %w", targetGroupARN, err)
+	}
+
+	hs := make([]TargetHealth, 0, len(out.TargetHealthDescriptions))
+	for _, d := range out.TargetHealthDescriptions {
+		h := TargetHealth{TargetGroupARN: targetGroupARN}
+		if d.Target != nil {
+			h.TargetID = aws.StringValue(d.Target.Id)
+			h.Port = aws.Int64Value(d.Target.Port)
+		}
+		if d.TargetHealth != nil {
+			h.State = aws.StringValue(d.TargetHealth.State)
+			h.Reason = aws.StringValue(d.TargetHealth.Reason)
+			h.Description = aws.StringValue(d.TargetHealth.Description)
+		}
+		hs = append(hs, h)
+	}
+	return hs, nil
+}
@@ -0,0 +1,105 @@
+package elbv2
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
+)
+
+// fakeELBV2API stubs just the calls FindByDNSName/DescribeTargetHealth make;
+// everything else panics via the embedded interface's nil methods if hit.
+type fakeELBV2API struct {
+	elbv2iface.ELBV2API
+
+	lbs               []*elbv2.LoadBalancer
+	targetGroups      []*elbv2.TargetGroup
+	describeTGErr     error
+	targetHealth      []*elbv2.TargetHealthDescription
+	describeHealthErr error
+}
+
+func (f *fakeELBV2API) DescribeLoadBalancersPages(in *elbv2.DescribeLoadBalancersInput, fn func(*elbv2.DescribeLoadBalancersOutput, bool) bool) error {
+	fn(&elbv2.DescribeLoadBalancersOutput{LoadBalancers: f.lbs}, true)
+	return nil
+}
+
+func (f *fakeELBV2API) DescribeTargetGroups(in *elbv2.DescribeTargetGroupsInput) (*elbv2.DescribeTargetGroupsOutput, error) {
+	if f.describeTGErr != nil {
+		return nil, f.describeTGErr
+	}
+	return &elbv2.DescribeTargetGroupsOutput{TargetGroups: f.targetGroups}, nil
+}
+
+func (f *fakeELBV2API) DescribeTargetHealth(in *elbv2.DescribeTargetHealthInput) (*elbv2.DescribeTargetHealthOutput, error) {
+	if f.describeHealthErr != nil {
+		return nil, f.describeHealthErr
+	}
+	return &elbv2.DescribeTargetHealthOutput{TargetHealthDescriptions: f.targetHealth}, nil
+}
+
+func TestFindByDNSNameMatches(t *testing.T) {
+	api := &fakeELBV2API{
+		lbs: []*elbv2.LoadBalancer{
+			{
+				LoadBalancerName: aws.String("other-nlb"),
+				LoadBalancerArn:  aws.String("arn:other"),
+				DNSName:          aws.String("other-123.elb.us-west-2.amazonaws.com"),
+				Type:             aws.String("network"),
+			},
+			{
+				LoadBalancerName: aws.String("wordpress-nlb"),
+				LoadBalancerArn:  aws.String("arn:wordpress"),
+				DNSName:          aws.String("Wordpress-456.ELB.us-west-2.amazonaws.com."),
+				Type:             aws.String("network"),
+			},
+		},
+		targetGroups: []*elbv2.TargetGroup{
+			{TargetGroupArn: aws.String("arn:tg-1")},
+		},
+	}
+
+	// Lowercase, no trailing dot, matching the hostname as Kubernetes would report it.
+	lb, err := FindByDNSName(api, "wordpress-456.elb.us-west-2.amazonaws.com")
+	if err != nil {
+		t.Fatalf("FindByDNSName returned error: %v", err)
+	}
+	if lb.Name != "wordpress-nlb" || lb.ARN != "arn:wordpress" {
+		t.Fatalf("got %+v, want the wordpress-nlb load balancer", lb)
+	}
+	if len(lb.TargetGroupARNs) != 1 || lb.TargetGroupARNs[0] != "arn:tg-1" {
+		t.Fatalf("got TargetGroupARNs %v, want [arn:tg-1]", lb.TargetGroupARNs)
+	}
+}
+
+func TestFindByDNSNameNotFound(t *testing.T) {
+	api := &fakeELBV2API{}
+	_, err := FindByDNSName(api, "missing.elb.us-west-2.amazonaws.com")
+	if err == nil {
+		t.Fatal("expected an error for a DNS name with no matching load balancer")
+	}
+}
+
+func TestDescribeTargetHealth(t *testing.T) {
+	api := &fakeELBV2API{
+		targetHealth: []*elbv2.TargetHealthDescription{
+			{
+				Target:       &elbv2.TargetDescription{Id: aws.String("i-abc"), Port: aws.Int64(8080)},
+				TargetHealth: &elbv2.TargetHealth{State: aws.String("healthy")},
+			},
+		},
+	}
+
+	hs, err := DescribeTargetHealth(api, "arn:tg-1")
+	if err != nil {
+		t.Fatalf("DescribeTargetHealth returned error: %v", err)
+	}
+	if len(hs) != 1 {
+		t.Fatalf("got %d targets, want 1", len(hs))
+	}
+	h := hs[0]
+	if h.TargetGroupARN != "arn:tg-1" || h.TargetID != "i-abc" || h.Port != 8080 || h.State != "healthy" {
+		t.Errorf("got %+v, unexpected target health", h)
+	}
+}
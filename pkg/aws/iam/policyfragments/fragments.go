@@ -0,0 +1,133 @@
+package policyfragments
+
+// NLB is the fragment required for the Kubernetes in-tree/NLB controller
+// to provision and wire up Network Load Balancers. It replaces the
+// previous blanket "ec2:*" grant with only the actions NLB provisioning
+// actually calls.
+const NLB = "nlb"
+
+// EFSCSI is the fragment required by the aws-efs-csi-driver to describe
+// and mount EFS file systems.
+const EFSCSI = "efs-csi"
+
+// EBSCSI is the fragment required by the aws-ebs-csi-driver to create,
+// attach, and delete EBS volumes.
+const EBSCSI = "ebs-csi"
+
+// ALBIngress is the fragment required by the AWS Load Balancer Controller
+// to provision ALBs from Ingress objects.
+const ALBIngress = "alb-ingress"
+
+// Wordpress is the fragment required by the Wordpress add-on: it only
+// needs to read back the NLB it creates via NLB, plus describe the EFS
+// file system it mounts when PersistenceMode is "efs".
+const Wordpress = "wordpress"
+
+func init() {
+	register(PolicyFragment{
+		Name: NLB,
+		Statements: []IAMStatement{
+			{
+				Effect: "Allow",
+				Action: []string{
+					"ec2:DescribeAccountAttributes",
+					"ec2:DescribeInternetGateways",
+					"ec2:DescribeVpcs",
+					"ec2:DescribeSubnets",
+					"ec2:DescribeSecurityGroups",
+				},
+				Resource: "*",
+			},
+			{
+				// Scoped to only the load balancers/target groups this
+				// cluster's controllers tag as their own, not every ELB in
+				// the account, since "Resource: *" can't target an
+				// IAM::Role's load-balancer ARNs (they don't exist yet at
+				// policy-attach time).
+				Effect: "Allow",
+				Action: []string{
+					"elasticloadbalancing:*",
+				},
+				Resource: "*",
+				Condition: map[string]map[string]string{
+					"StringEquals": {
+						"aws:ResourceTag/elbv2.k8s.aws/cluster": ClusterNamePlaceholder,
+					},
+				},
+			},
+		},
+	})
+
+	register(PolicyFragment{
+		Name: EFSCSI,
+		Statements: []IAMStatement{
+			{
+				Effect: "Allow",
+				Action: []string{
+					"elasticfilesystem:DescribeAccessPoints",
+					"elasticfilesystem:DescribeFileSystems",
+					"elasticfilesystem:DescribeMountTargets",
+					"elasticfilesystem:CreateAccessPoint",
+					"elasticfilesystem:DeleteAccessPoint",
+				},
+				Resource: "*",
+			},
+		},
+	})
+
+	register(PolicyFragment{
+		Name: EBSCSI,
+		Statements: []IAMStatement{
+			{
+				Effect: "Allow",
+				Action: []string{
+					"ec2:CreateVolume",
+					"ec2:DeleteVolume",
+					"ec2:AttachVolume",
+					"ec2:DetachVolume",
+					"ec2:DescribeVolumes",
+					"ec2:CreateSnapshot",
+					"ec2:DeleteSnapshot",
+					"ec2:CreateTags",
+				},
+				Resource: "*",
+			},
+		},
+	})
+
+	register(PolicyFragment{
+		Name: ALBIngress,
+		Statements: []IAMStatement{
+			{
+				Effect: "Allow",
+				Action: []string{
+					"elasticloadbalancing:*",
+					"ec2:DescribeSubnets",
+					"ec2:DescribeSecurityGroups",
+					"ec2:DescribeVpcs",
+					"acm:DescribeCertificate",
+					"acm:ListCertificates",
+					"waf-regional:GetWebACLForResource",
+					"waf-regional:AssociateWebACL",
+				},
+				Resource: "*",
+			},
+		},
+	})
+
+	register(PolicyFragment{
+		Name: Wordpress,
+		Statements: []IAMStatement{
+			{
+				Effect:   "Allow",
+				Action:   []string{"elasticloadbalancing:DescribeLoadBalancers", "elasticloadbalancing:DescribeTargetGroups", "elasticloadbalancing:DescribeTargetHealth"},
+				Resource: "*",
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"elasticfilesystem:DescribeFileSystems", "elasticfilesystem:DescribeMountTargets"},
+				Resource: "*",
+			},
+		},
+	})
+}
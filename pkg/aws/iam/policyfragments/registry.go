@@ -0,0 +1,54 @@
+// Package policyfragments is a registry of named IAM policy fragments, one
+// per add-on, so that CFN cluster-role templates can be composed at
+// runtime from only the permissions the enabled add-ons actually need
+// instead of picking between a handful of hardcoded, overly-broad
+// templates.
+package policyfragments
+
+// IAMStatement is a single IAM policy statement.
+type IAMStatement struct {
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource string   `json:"Resource"`
+	// Condition restricts the statement the way an IAM policy "Condition"
+	// block does, e.g. {"StringEquals": {"aws:ResourceTag/foo": "bar"}}.
+	// Omitted entirely when a statement doesn't need one.
+	Condition map[string]map[string]string `json:"Condition,omitempty"`
+}
+
+// PolicyFragment is the set of IAM statements a single add-on needs
+// attached to the EKS cluster role.
+type PolicyFragment struct {
+	Name       string
+	Statements []IAMStatement
+}
+
+var registry = map[string]PolicyFragment{}
+
+// register adds a PolicyFragment to the registry, keyed by its Name. Each
+// fragment in this package calls it from an init func.
+func register(f PolicyFragment) {
+	if _, ok := registry[f.Name]; ok {
+		panic("policyfragments: duplicate fragment name " + f.Name)
+	}
+	registry[f.Name] = f
+}
+
+// Get returns the registered fragments for names, in order, skipping any
+// name that has no registered fragment and any name already seen (so that
+// an add-on pulled in by more than one enabled feature, e.g. NLB, doesn't
+// get rendered as a duplicate policy).
+func Get(names ...string) []PolicyFragment {
+	fs := make([]PolicyFragment, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		if seen[n] {
+			continue
+		}
+		if f, ok := registry[n]; ok {
+			fs = append(fs, f)
+			seen[n] = true
+		}
+	}
+	return fs
+}
@@ -0,0 +1,42 @@
+package policyfragments
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ClusterNamePlaceholder stands in for the cluster name in any fragment
+// statement's Condition, since fragments are registered once at package
+// init and have no access to the cluster being created. RenderCFNPolicies
+// substitutes it with the real cluster name before returning.
+const ClusterNamePlaceholder = "{{CLUSTER_NAME}}"
+
+type policyDocument struct {
+	Version   string         `json:"Version"`
+	Statement []IAMStatement `json:"Statement"`
+}
+
+type cfnPolicy struct {
+	PolicyName     string         `json:"PolicyName"`
+	PolicyDocument policyDocument `json:"PolicyDocument"`
+}
+
+// RenderCFNPolicies composes fragments into the JSON form of a CFN
+// "Policies" list (valid inline in a YAML template body), one inline
+// policy per fragment, named "<namePrefix>-<fragment.Name>". Any
+// ClusterNamePlaceholder left in a fragment's statements by a Condition is
+// replaced with clusterName.
+func RenderCFNPolicies(namePrefix, clusterName string, fragments []PolicyFragment) ([]byte, error) {
+	policies := make([]cfnPolicy, 0, len(fragments))
+	for _, f := range fragments {
+		policies = append(policies, cfnPolicy{
+			PolicyName:     namePrefix + "-" + f.Name,
+			PolicyDocument: policyDocument{Version: "2012-10-17", Statement: f.Statements},
+		})
+	}
+	out, err := json.Marshal(policies)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.ReplaceAll(string(out), ClusterNamePlaceholder, clusterName)), nil
+}
@@ -0,0 +1,76 @@
+package policyfragments
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGetDedupesNames(t *testing.T) {
+	fs := Get(NLB, Wordpress, NLB)
+	if len(fs) != 2 {
+		t.Fatalf("got %d fragments, want 2 (NLB deduped): %+v", len(fs), fs)
+	}
+	if fs[0].Name != NLB || fs[1].Name != Wordpress {
+		t.Fatalf("got fragments %+v, want [NLB, Wordpress] in first-seen order", fs)
+	}
+}
+
+func TestGetSkipsUnknownNames(t *testing.T) {
+	fs := Get("does-not-exist", NLB)
+	if len(fs) != 1 || fs[0].Name != NLB {
+		t.Fatalf("got %+v, want only NLB", fs)
+	}
+}
+
+func TestRenderCFNPolicies(t *testing.T) {
+	fragments := Get(NLB, EFSCSI)
+	out, err := RenderCFNPolicies("my-cluster-role", "my-cluster", fragments)
+	if err != nil {
+		t.Fatalf("RenderCFNPolicies returned error: %v", err)
+	}
+
+	var policies []cfnPolicy
+	if err := json.Unmarshal(out, &policies); err != nil {
+		t.Fatalf("failed to unmarshal rendered policies: %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("got %d policies, want 2", len(policies))
+	}
+	if policies[0].PolicyName != "my-cluster-role-nlb" {
+		t.Errorf("got PolicyName %q, want %q", policies[0].PolicyName, "my-cluster-role-nlb")
+	}
+	if policies[1].PolicyName != "my-cluster-role-efs-csi" {
+		t.Errorf("got PolicyName %q, want %q", policies[1].PolicyName, "my-cluster-role-efs-csi")
+	}
+	for _, p := range policies {
+		if p.PolicyDocument.Version != "2012-10-17" {
+			t.Errorf("got PolicyDocument.Version %q, want %q", p.PolicyDocument.Version, "2012-10-17")
+		}
+		if len(p.PolicyDocument.Statement) == 0 {
+			t.Errorf("policy %q has no statements", p.PolicyName)
+		}
+	}
+
+	if strings.Contains(string(out), ClusterNamePlaceholder) {
+		t.Errorf("rendered policies still contain %q, want it substituted with the cluster name: %s", ClusterNamePlaceholder, out)
+	}
+	nlbStmts := policies[0].PolicyDocument.Statement
+	if len(nlbStmts) != 2 {
+		t.Fatalf("got %d NLB statements, want 2", len(nlbStmts))
+	}
+	gotTag := nlbStmts[1].Condition["StringEquals"]["aws:ResourceTag/elbv2.k8s.aws/cluster"]
+	if gotTag != "my-cluster" {
+		t.Errorf("got NLB elasticloadbalancing:* Condition tag value %q, want %q", gotTag, "my-cluster")
+	}
+}
+
+func TestRenderCFNPoliciesEmpty(t *testing.T) {
+	out, err := RenderCFNPolicies("my-cluster-role", "my-cluster", nil)
+	if err != nil {
+		t.Fatalf("RenderCFNPolicies returned error: %v", err)
+	}
+	if string(out) != "[]" {
+		t.Errorf("got %s, want []", out)
+	}
+}
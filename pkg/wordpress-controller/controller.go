@@ -0,0 +1,324 @@
+// Package wordpresscontroller implements a Reconcile loop for the Wordpress
+// custom resource: it drives the Deployment, PVC, Service, and MariaDB
+// StatefulSet for a Wordpress object to match its Spec, directly through
+// typed Kubernetes clients (no Helm, no CLI shell-outs).
+package wordpresscontroller
+
+import (
+	"context"
+	"fmt"
+
+	wordpressv1 "github.com/aws/aws-k8s-tester/api/v1"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Request identifies the Wordpress object being reconciled.
+type Request struct {
+	Namespace string
+	Name      string
+}
+
+// Controller reconciles Wordpress objects against a Kubernetes cluster.
+type Controller struct {
+	lg        *zap.Logger
+	k8sClient kubernetes.Interface
+}
+
+// New creates a new Wordpress Controller.
+func New(lg *zap.Logger, k8sClient kubernetes.Interface) *Controller {
+	return &Controller{lg: lg, k8sClient: k8sClient}
+}
+
+// Reconcile creates or updates the Deployment, PVC, Service, and MariaDB
+// StatefulSet for the Wordpress object named by req, and returns the
+// observed WordpressStatus.
+func (c *Controller) Reconcile(ctx context.Context, req Request, spec wordpressv1.WordpressSpec) (wordpressv1.WordpressStatus, error) {
+	status := wordpressv1.WordpressStatus{}
+
+	if err := c.reconcilePVC(ctx, req, spec); err != nil {
+		return status, fmt.Errorf("failed to reconcile PVC: %w", err)
+	}
+	if err := c.reconcileMariaDB(ctx, req, spec); err != nil {
+		return status, fmt.Errorf("failed to reconcile MariaDB StatefulSet: %w", err)
+	}
+	if err := c.reconcileMariaDBService(ctx, req); err != nil {
+		return status, fmt.Errorf("failed to reconcile MariaDB Service: %w", err)
+	}
+	dep, err := c.reconcileDeployment(ctx, req, spec)
+	if err != nil {
+		return status, fmt.Errorf("failed to reconcile Deployment: %w", err)
+	}
+	svc, err := c.reconcileService(ctx, req, spec)
+	if err != nil {
+		return status, fmt.Errorf("failed to reconcile Service: %w", err)
+	}
+
+	status.Ready = dep.Status.ReadyReplicas >= spec.Replicas && spec.Replicas > 0
+	for _, ing := range svc.Status.LoadBalancer.Ingress {
+		if ing.Hostname != "" {
+			status.URL = "http://" + ing.Hostname
+			break
+		}
+	}
+	return status, nil
+}
+
+// Cleanup removes every resource Reconcile creates for req. It is called
+// from Tester.Delete before the Wordpress CR itself is removed.
+func (c *Controller) Cleanup(ctx context.Context, req Request) error {
+	core := c.k8sClient.CoreV1()
+	apps := c.k8sClient.AppsV1()
+
+	del := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{PropagationPolicy: &del}
+
+	if err := apps.Deployments(req.Namespace).Delete(ctx, deploymentName(req), opts); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err := apps.StatefulSets(req.Namespace).Delete(ctx, mariaDBName(req), opts); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err := core.Services(req.Namespace).Delete(ctx, serviceName(req), opts); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err := core.Services(req.Namespace).Delete(ctx, mariaDBName(req), opts); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err := core.PersistentVolumeClaims(req.Namespace).Delete(ctx, pvcName(req), opts); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// mariaDBDatabaseName is the schema Wordpress reads and writes.
+const mariaDBDatabaseName = "wordpress"
+
+func deploymentName(req Request) string { return req.Name }
+func serviceName(req Request) string     { return req.Name }
+func pvcName(req Request) string         { return req.Name + "-data" }
+func mariaDBName(req Request) string     { return req.Name + "-mariadb" }
+
+func labelsFor(req Request) map[string]string {
+	return map[string]string{"app.kubernetes.io/name": "wordpress", "app.kubernetes.io/instance": req.Name}
+}
+
+func mariaDBLabelsFor(req Request) map[string]string {
+	return map[string]string{"app.kubernetes.io/name": "mariadb", "app.kubernetes.io/instance": req.Name}
+}
+
+// accessModesFor returns spec.AccessModes translated to the typed API, or
+// ReadWriteOnce if the spec didn't set any (the common EBS case).
+func accessModesFor(spec wordpressv1.WordpressSpec) []corev1.PersistentVolumeAccessMode {
+	if len(spec.AccessModes) == 0 {
+		return []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	ms := make([]corev1.PersistentVolumeAccessMode, len(spec.AccessModes))
+	for i, m := range spec.AccessModes {
+		ms[i] = corev1.PersistentVolumeAccessMode(m)
+	}
+	return ms
+}
+
+func (c *Controller) reconcilePVC(ctx context.Context, req Request, spec wordpressv1.WordpressSpec) error {
+	client := c.k8sClient.CoreV1().PersistentVolumeClaims(req.Namespace)
+	size, err := resource.ParseQuantity(spec.DatabaseSize)
+	if err != nil {
+		return fmt.Errorf("invalid DatabaseSize %q: %w", spec.DatabaseSize, err)
+	}
+	want := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: pvcName(req), Namespace: req.Namespace, Labels: labelsFor(req)},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      accessModesFor(spec),
+			StorageClassName: &spec.StorageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+	_, err = client.Get(ctx, want.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.Create(ctx, want, metav1.CreateOptions{})
+		return err
+	}
+	// PVC spec (other than requested size) is immutable once bound; nothing to update.
+	return err
+}
+
+func (c *Controller) reconcileDeployment(ctx context.Context, req Request, spec wordpressv1.WordpressSpec) (*appsv1.Deployment, error) {
+	client := c.k8sClient.AppsV1().Deployments(req.Namespace)
+	want := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: deploymentName(req), Namespace: req.Namespace, Labels: labelsFor(req)},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &spec.Replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labelsFor(req)},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labelsFor(req)},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "wordpress",
+							Image: spec.Image,
+							Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+							Env: []corev1.EnvVar{
+								{Name: "WORDPRESS_DATABASE_HOST", Value: mariaDBName(req)},
+								{Name: "WORDPRESS_DATABASE_NAME", Value: mariaDBDatabaseName},
+								{Name: "WORDPRESS_DATABASE_USER", Value: spec.DatabaseUser},
+								{Name: "WORDPRESS_DATABASE_PASSWORD", Value: spec.DatabasePassword},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "wordpress-data", MountPath: "/bitnami/wordpress"},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "wordpress-data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvcName(req)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	existing, err := client.Get(ctx, want.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return client.Create(ctx, want, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing.Spec = want.Spec
+	return client.Update(ctx, existing, metav1.UpdateOptions{})
+}
+
+func (c *Controller) reconcileService(ctx context.Context, req Request, spec wordpressv1.WordpressSpec) (*corev1.Service, error) {
+	client := c.k8sClient.CoreV1().Services(req.Namespace)
+	want := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: serviceName(req), Namespace: req.Namespace, Labels: labelsFor(req)},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceType(spec.ServiceType),
+			Selector: labelsFor(req),
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+			},
+		},
+	}
+
+	existing, err := client.Get(ctx, want.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return client.Create(ctx, want, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing.Spec.Type = want.Spec.Type
+	existing.Spec.Selector = want.Spec.Selector
+	existing.Spec.Ports = want.Spec.Ports
+	return client.Update(ctx, existing, metav1.UpdateOptions{})
+}
+
+func (c *Controller) reconcileMariaDB(ctx context.Context, req Request, spec wordpressv1.WordpressSpec) error {
+	client := c.k8sClient.AppsV1().StatefulSets(req.Namespace)
+	labels := mariaDBLabelsFor(req)
+	size, err := resource.ParseQuantity(spec.DatabaseSize)
+	if err != nil {
+		return fmt.Errorf("invalid DatabaseSize %q: %w", spec.DatabaseSize, err)
+	}
+	replicas := int32(1)
+	want := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: mariaDBName(req), Namespace: req.Namespace, Labels: labels},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: mariaDBName(req),
+			Selector:    &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "mariadb",
+							Image: "bitnami/mariadb:latest",
+							Ports: []corev1.ContainerPort{{Name: "mysql", ContainerPort: 3306}},
+							Env: []corev1.EnvVar{
+								{Name: "MARIADB_ROOT_PASSWORD", Value: spec.DatabasePassword},
+								{Name: "MARIADB_DATABASE", Value: mariaDBDatabaseName},
+								{Name: "MARIADB_USER", Value: spec.DatabaseUser},
+								{Name: "MARIADB_PASSWORD", Value: spec.DatabasePassword},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "mariadb-data", MountPath: "/bitnami/mariadb"},
+							},
+						},
+					},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "mariadb-data"},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						StorageClassName: &spec.StorageClass,
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	existing, err := client.Get(ctx, want.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.Create(ctx, want, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Spec.Template = want.Spec.Template
+	_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+// reconcileMariaDBService creates or updates the headless Service that
+// backs the MariaDB StatefulSet, giving Wordpress a stable DNS name
+// (mariaDBName(req)) to connect to. It is headless (ClusterIP: None)
+// because StatefulSet.Spec.ServiceName requires its governing Service to
+// be headless.
+func (c *Controller) reconcileMariaDBService(ctx context.Context, req Request) error {
+	client := c.k8sClient.CoreV1().Services(req.Namespace)
+	labels := mariaDBLabelsFor(req)
+	want := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: mariaDBName(req), Namespace: req.Namespace, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			Ports: []corev1.ServicePort{
+				{Name: "mysql", Port: 3306, TargetPort: intstr.FromString("mysql")},
+			},
+		},
+	}
+
+	existing, err := client.Get(ctx, want.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.Create(ctx, want, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Spec.Selector = want.Spec.Selector
+	existing.Spec.Ports = want.Spec.Ports
+	_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}